@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/Harvey-OS/ninep/protocol"
+)
+
+// A Codec encodes and decodes 9P messages to and from their wire
+// representation. It is orthogonal to framing, which a Channel owns,
+// so a single Codec implementation can be driven over any transport.
+type Codec interface {
+	Decode(msg []byte) (interface{}, error)
+	Encode(v interface{}) ([]byte, error)
+}
+
+// RawCodec is the Codec every handler in this package currently
+// speaks: it treats a 9P message as an opaque, already-framed byte
+// slice wrapped in a *bytes.Buffer, which is exactly what the
+// ServerReply functions in tests.go, dialect.go and fuzz.go expect to
+// read from and write into.
+type RawCodec struct{}
+
+// Decode wraps msg in a *bytes.Buffer without interpreting it, leaving
+// the protocol.Unmarshal* calls inside each ServerReply to do the
+// actual parsing.
+func (RawCodec) Decode(msg []byte) (interface{}, error) {
+	return bytes.NewBuffer(append([]byte(nil), msg...)), nil
+}
+
+// Encode accepts either a *bytes.Buffer (the common case, produced by
+// a ServerReply) or a raw []byte (for handlers that build a frame
+// directly, such as the header* emitters below) and returns the bytes
+// to hand to Channel.WriteFcall.
+func (RawCodec) Encode(v interface{}) ([]byte, error) {
+	switch msg := v.(type) {
+	case *bytes.Buffer:
+		return msg.Bytes(), nil
+	case []byte:
+		return msg, nil
+	default:
+		return nil, fmt.Errorf("codec: cannot encode value of type %T", v)
+	}
+}
+
+// A Channel reads and writes whole, length-framed 9P messages. Moving
+// framing here means a fault-injection handler no longer needs to
+// know whether it is talking to a plain TCP client, a Unix-domain
+// socket or a client behind TLS: it only ever sees full messages in
+// and hands full messages back.
+type Channel interface {
+	ReadFcall() ([]byte, error)
+	WriteFcall(msg []byte) error
+}
+
+// streamChannel implements Channel for any io.ReadWriter. net.TCPConn,
+// net.UnixConn and tls.Conn all satisfy io.ReadWriter and share the
+// same length-prefixed framing, so one implementation covers them all.
+type streamChannel struct {
+	rw io.ReadWriter
+}
+
+// ReadFcall reads the four-byte little-endian size prefix followed by
+// the rest of the message and returns the whole frame, size prefix
+// included, so callers can still hand-craft malformed replies the way
+// the handlers in tests.go and dialect.go do.
+func (c *streamChannel) ReadFcall() ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(c.rw, size[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.LittleEndian.Uint32(size[:])
+	if n < 4 {
+		return nil, fmt.Errorf("channel: message size %d is shorter than the header itself", n)
+	}
+
+	msg := make([]byte, n)
+	copy(msg, size[:])
+	if _, err := io.ReadFull(c.rw, msg[4:]); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
+
+// WriteFcall writes msg verbatim, including its own size prefix. It
+// never recomputes the prefix, so a deliberately wrong one (as used by
+// HeaderTooShort1, HeaderTooShort2 and HeaderTooLarge) reaches the
+// client unmodified.
+func (c *streamChannel) WriteFcall(msg []byte) error {
+	_, err := c.rw.Write(msg)
+	return err
+}
+
+// NewTCPChannel returns a Channel that frames 9P messages over a
+// plain TCP connection.
+func NewTCPChannel(conn *net.TCPConn) Channel {
+	return &streamChannel{rw: conn}
+}
+
+// NewUnixChannel returns a Channel that frames 9P messages over a
+// Unix-domain socket connection.
+func NewUnixChannel(conn *net.UnixConn) Channel {
+	return &streamChannel{rw: conn}
+}
+
+// NewTLSChannel returns a Channel that frames 9P messages over an
+// already-handshaked TLS connection. This is what lets the fault
+// handlers be driven against a client that negotiates 9P over TLS.
+func NewTLSChannel(conn *tls.Conn) Channel {
+	return &streamChannel{rw: conn}
+}
+
+// The handlers below are the raw-byte emitters the header-level fault
+// cases in tests.go are built on: each returns the exact frame a
+// Channel should hand to WriteFcall, with no further processing.
+
+// headerTooShort1Frame is shorter than even the four-byte size field.
+func headerTooShort1Frame() []byte {
+	return []byte{0}
+}
+
+// headerTooShort2Frame carries a size field too small for a valid 9P
+// message.
+func headerTooShort2Frame() []byte {
+	l := uint64(6)
+	return []byte{uint8(l), uint8(l >> 8), uint8(l >> 16), uint8(l >> 24)}
+}
+
+// headerTooLargeFrame carries a size field larger than the number of
+// bytes actually sent.
+func headerTooLargeFrame() []byte {
+	l := uint64(42)
+	return []byte{uint8(l), uint8(l >> 8), uint8(l >> 16), uint8(l >> 24)}
+}
+
+// headerWrongTypeFrame echoes tag t back with the Tversion type
+// instead of Rversion.
+func headerWrongTypeFrame(t protocol.Tag) []byte {
+	msg := []byte{0, 0, 0, 0,
+		uint8(protocol.Tversion),
+		byte(t), byte(t >> 8),
+		0, 0, 0, 0}
+	fixupFrameSize(msg)
+	return msg
+}
+
+// headerInvalidTypeFrame echoes tag t back with protocol.Tlast, a type
+// value no valid 9P message ever carries.
+func headerInvalidTypeFrame(t protocol.Tag) []byte {
+	return []byte{0, 0, 0, 0,
+		uint8(protocol.Tlast),
+		byte(t), byte(t >> 8),
+		0, 0, 0, 0}
+}
+
+// headerTagMismatchFrame replies Rversion with tag t+1, one past the
+// tag the client actually sent.
+func headerTagMismatchFrame(t protocol.Tag) []byte {
+	t++
+	return []byte{0, 0, 0, 0,
+		uint8(protocol.Rversion),
+		byte(t), byte(t >> 8),
+		0, 0, 0, 0}
+}
+
+// headerTypeMismatchFrame replies Rversion with the tag the client
+// sent; callers register it against a different expected T-message so
+// the reply is valid but unsolicited.
+func headerTypeMismatchFrame(t protocol.Tag) []byte {
+	return []byte{0, 0, 0, 0,
+		uint8(protocol.Rversion),
+		byte(t), byte(t >> 8),
+		0, 0, 0, 0}
+}
+
+// rattachInvalidLengthFrame marshals a well-formed Rattach and then
+// shrinks its size prefix by one byte, so the trailing QID no longer
+// fits inside the declared message length.
+func rattachInvalidLengthFrame(t protocol.Tag) []byte {
+	var b bytes.Buffer
+	protocol.MarshalRattachPkt(&b, t, protocol.QID{})
+
+	frame := b.Bytes()
+	l := uint64(len(frame) - 1)
+	copy(frame, []byte{uint8(l), uint8(l >> 8), uint8(l >> 16), uint8(l >> 24)})
+	return frame
+}
+
+// rversionInvalidLengthFrame marshals a well-formed Rversion and then
+// shrinks its size prefix by one byte, so the version string's own
+// length field claims more bytes than the packet actually carries.
+func rversionInvalidLengthFrame(t protocol.Tag, msize protocol.MaxSize, version string) []byte {
+	var b bytes.Buffer
+	protocol.MarshalRversionPkt(&b, t, msize, version)
+
+	frame := b.Bytes()
+	l := uint64(len(frame) - 1)
+	copy(frame, []byte{uint8(l), uint8(l >> 8), uint8(l >> 16), uint8(l >> 24)})
+	return frame
+}
+
+// fixupFrameSize patches the four-byte size prefix of a fully built
+// frame in place, mirroring the inline fixups used throughout
+// tests.go and dialect.go.
+func fixupFrameSize(msg []byte) {
+	l := uint64(len(msg))
+	copy(msg, []byte{uint8(l), uint8(l >> 8), uint8(l >> 16), uint8(l >> 24)})
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/Harvey-OS/ninep/protocol"
+)
+
+// Message types introduced by the 9P2000.L dialect. The vendored
+// github.com/Harvey-OS/ninep/protocol package only implements plain
+// 9P2000 and therefore has no constants or (un)marshallers for these;
+// replies are assembled by hand the same way HeaderWrongType does for
+// base 9P2000.
+const (
+	Rlerror  = 7
+	Tlopen   = 12
+	Rlopen   = 13
+	Tgetattr = 24
+	Rgetattr = 25
+	Treaddir = 40
+	Rreaddir = 41
+)
+
+// putUint32LE appends v to b in the little-endian order used
+// throughout the 9P wire format.
+func putUint32LE(b *bytes.Buffer, v uint32) {
+	b.Write([]byte{uint8(v), uint8(v >> 8), uint8(v >> 16), uint8(v >> 24)})
+}
+
+// putUint64LE appends v to b in the little-endian order used
+// throughout the 9P wire format.
+func putUint64LE(b *bytes.Buffer, v uint64) {
+	b.Write([]byte{
+		uint8(v), uint8(v >> 8), uint8(v >> 16), uint8(v >> 24),
+		uint8(v >> 32), uint8(v >> 40), uint8(v >> 48), uint8(v >> 56),
+	})
+}
+
+// putUint16LE appends v to b in the little-endian order used by 9P
+// strings, e.g. the name field of a Linux dirent.
+func putUint16LE(b *bytes.Buffer, v uint16) {
+	b.Write([]byte{uint8(v), uint8(v >> 8)})
+}
+
+// putQID appends the on-wire encoding of qid to b: a one-byte type, a
+// four-byte version and an eight-byte path.
+func putQID(b *bytes.Buffer, qid protocol.QID) {
+	b.WriteByte(qid.Type)
+	putUint32LE(b, qid.Version)
+	putUint64LE(b, qid.Path)
+}
+
+// fixupSize patches the four-byte size field at the start of b with
+// the buffer's actual length, as every ServerReply in this package
+// does once the message body has been written.
+func fixupSize(b *bytes.Buffer) {
+	l := uint64(b.Len())
+	copy(b.Bytes(), []byte{uint8(l), uint8(l >> 8), uint8(l >> 16), uint8(l >> 24)})
+}
+
+// unmarshalLHeader extracts the tag from the common 9P header without
+// otherwise interpreting the message, since none of the 9P2000.L
+// T-messages below are understood by the vendored protocol package.
+func unmarshalLHeader(b *bytes.Buffer) (uint16, error) {
+	buf := b.Bytes()
+	if len(buf) < 7 {
+		return 0, fmt.Errorf("dialect: message too short to contain a 9P header")
+	}
+
+	return uint16(buf[5]) | uint16(buf[6])<<8, nil
+}
+
+// Replies with a plain "9P2000" version string no matter which
+// dialect the client advertised, e.g. downgrading a client that asked
+// for "9P2000.L". The client should reject the downgrade rather than
+// silently falling back to the base protocol.
+func RversionDowngraded(b *bytes.Buffer) error {
+	TMsize, _, t, err := protocol.UnmarshalTversionPkt(b)
+	if err != nil {
+		return err
+	}
+
+	protocol.MarshalRversionPkt(b, t, TMsize, "9P2000")
+	return nil
+}
+
+// Replies with a dialect string the client never advertised in its
+// Tversion request. The client should reject a version it did not
+// offer.
+func RversionUnadvertisedDialect(b *bytes.Buffer) error {
+	TMsize, TVersion, t, err := protocol.UnmarshalTversionPkt(b)
+	if err != nil {
+		return err
+	}
+
+	reply := "9P2000.L"
+	if TVersion == reply {
+		reply = "9P2000.u"
+	}
+
+	protocol.MarshalRversionPkt(b, t, TMsize, reply)
+	return nil
+}
+
+// Replies to a Tstat request with a base 9P2000 stat message even
+// though the session negotiated 9P2000.u, which requires the extended
+// stat encoding (numeric n_uid/n_gid/n_muid and an extension field).
+// The vendored protocol package cannot marshal the extended form, so
+// this reuses the base encoding to exercise a client that insists on
+// the .u fields being present.
+func RstatDotuMissingExtension(b *bytes.Buffer) error {
+	_, t, err := protocol.UnmarshalTstatPkt(b)
+	if err != nil {
+		return err
+	}
+
+	dir := protocol.Dir{
+		Type:    9001,
+		Dev:     5,
+		QID:     protocol.QID{Type: 0, Version: 2342, Path: 1337},
+		Mode:    0644,
+		Atime:   1494443596,
+		Mtime:   1494443609,
+		Length:  0,
+		Name:    "dotufile",
+		User:    "testuser",
+		Group:   "testgroup",
+		ModUser: "ken",
+	}
+
+	var B bytes.Buffer
+	protocol.Marshaldir(&B, dir)
+
+	protocol.MarshalRstatPkt(b, t, B.Bytes())
+	return nil
+}
+
+// Replies to a Tlopen request with a valid QID for a plain file and a
+// zero iounit. The client must be able to parse this successfully.
+func RlopenSuccess(b *bytes.Buffer) error {
+	t, err := unmarshalLHeader(b)
+	if err != nil {
+		return err
+	}
+
+	b.Reset()
+	b.Write([]byte{0, 0, 0, 0, uint8(Rlopen), byte(t), byte(t >> 8)})
+	putQID(b, protocol.QID{})
+	putUint32LE(b, 0) // iounit
+
+	fixupSize(b)
+	return nil
+}
+
+// Replies to a Treaddir request with a single directory entry. The
+// client must be able to parse this successfully.
+func RreaddirSuccess(b *bytes.Buffer) error {
+	t, err := unmarshalLHeader(b)
+	if err != nil {
+		return err
+	}
+
+	var entry bytes.Buffer
+	putQID(&entry, protocol.QID{Type: protocol.QTDIR, Path: 2})
+	putUint64LE(&entry, 1) // offset of the next entry
+	entry.WriteByte(protocol.QTDIR)
+	name := "subdir"
+	putUint16LE(&entry, uint16(len(name)))
+	entry.Write([]byte(name))
+
+	b.Reset()
+	b.Write([]byte{0, 0, 0, 0, uint8(Rreaddir), byte(t), byte(t >> 8)})
+	putUint32LE(b, uint32(entry.Len()))
+	b.Write(entry.Bytes())
+
+	fixupSize(b)
+	return nil
+}
+
+// Replies to a Tgetattr request with a fully populated Rgetattr
+// message whose valid mask has bit 63 set, a position the .L protocol
+// never assigns a meaning to. Every other field is well-formed, so the
+// message parses; the client should still flag the unknown valid bit
+// rather than silently ignoring it.
+func RgetattrSuccess(b *bytes.Buffer) error {
+	t, err := unmarshalLHeader(b)
+	if err != nil {
+		return err
+	}
+
+	const bogusValid uint64 = 1<<63 | 0x7ff // every defined field plus an unassigned bit
+
+	b.Reset()
+	b.Write([]byte{0, 0, 0, 0, uint8(Rgetattr), byte(t), byte(t >> 8)})
+	putUint64LE(b, bogusValid)
+	putQID(b, protocol.QID{})
+	putUint32LE(b, 0644)  // mode
+	putUint32LE(b, 0)     // uid
+	putUint32LE(b, 0)     // gid
+	putUint64LE(b, 1)     // nlink
+	putUint64LE(b, 0)     // rdev
+	putUint64LE(b, 0)     // size
+	putUint64LE(b, 4096)  // blksize
+	putUint64LE(b, 0)     // blocks
+	putUint64LE(b, 0)     // atime_sec
+	putUint64LE(b, 0)     // atime_nsec
+	putUint64LE(b, 0)     // mtime_sec
+	putUint64LE(b, 0)     // mtime_nsec
+	putUint64LE(b, 0)     // ctime_sec
+	putUint64LE(b, 0)     // ctime_nsec
+	putUint64LE(b, 0)     // btime_sec
+	putUint64LE(b, 0)     // btime_nsec
+	putUint64LE(b, 0)     // gen
+	putUint64LE(b, 0)     // data_version
+
+	fixupSize(b)
+	return nil
+}
+
+// Replies to any .L request with an Rlerror carrying a structured
+// Linux errno (EPERM) instead of the base Rerror string. The client
+// must be able to parse this successfully.
+func RlerrorSuccess(b *bytes.Buffer) error {
+	t, err := unmarshalLHeader(b)
+	if err != nil {
+		return err
+	}
+
+	const EPERM uint32 = 1
+
+	b.Reset()
+	b.Write([]byte{0, 0, 0, 0, uint8(Rlerror), byte(t), byte(t >> 8)})
+	putUint32LE(b, EPERM)
+
+	fixupSize(b)
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// Mutator applies one structural perturbation to an otherwise
+// well-formed frame and returns the (possibly resized) result.
+type Mutator func(frame []byte, rng *rand.Rand) []byte
+
+// mutators is the fixed menu of structural perturbations selectable
+// by index over the control socket, e.g. "fuzz rread 42 7" applies
+// mutators[42%len(mutators)] to a well-formed Rread.
+var mutators = []Mutator{
+	mutateFlipSizeBit,
+	mutateFlipTagBit,
+	mutateTruncate,
+	mutateAppendRandom,
+	mutateDuplicateLastLength,
+	mutateZeroContinuationByte,
+	mutateCountMismatch,
+	mutateFlipTypeByte,
+}
+
+// mutateFlipSizeBit flips one bit inside the four-byte size prefix.
+func mutateFlipSizeBit(frame []byte, rng *rand.Rand) []byte {
+	out := append([]byte(nil), frame...)
+	if len(out) >= 4 {
+		bit := rng.Intn(32)
+		out[bit/8] ^= 1 << uint(bit%8)
+	}
+	return out
+}
+
+// mutateFlipTagBit flips one bit inside the two-byte tag field.
+func mutateFlipTagBit(frame []byte, rng *rand.Rand) []byte {
+	out := append([]byte(nil), frame...)
+	if len(out) >= 7 {
+		bit := rng.Intn(16)
+		out[5+bit/8] ^= 1 << uint(bit%8)
+	}
+	return out
+}
+
+// mutateTruncate drops a random number of bytes from the end of the
+// frame without touching the (now stale) size prefix.
+func mutateTruncate(frame []byte, rng *rand.Rand) []byte {
+	out := append([]byte(nil), frame...)
+	if len(out) == 0 {
+		return out
+	}
+
+	n := 1 + rng.Intn(len(out))
+	return out[:len(out)-n]
+}
+
+// mutateAppendRandom appends random bytes past the length the size
+// prefix declares.
+func mutateAppendRandom(frame []byte, rng *rand.Rand) []byte {
+	out := append([]byte(nil), frame...)
+
+	extra := make([]byte, 1+rng.Intn(16))
+	rng.Read(extra)
+	return append(out, extra...)
+}
+
+// mutateDuplicateLastLength duplicates the final two bytes of the
+// frame, which for every message fuzzTargets covers line up with the
+// length field of the trailing string or count.
+func mutateDuplicateLastLength(frame []byte, rng *rand.Rand) []byte {
+	out := append([]byte(nil), frame...)
+	if len(out) < 2 {
+		return out
+	}
+
+	return append(out, out[len(out)-2:]...)
+}
+
+// mutateZeroContinuationByte zeroes the first UTF-8 continuation byte
+// it finds, corrupting any multi-byte rune inside a name field.
+func mutateZeroContinuationByte(frame []byte, rng *rand.Rand) []byte {
+	out := append([]byte(nil), frame...)
+	for i, c := range out {
+		if c&0xC0 == 0x80 {
+			out[i] = 0
+			break
+		}
+	}
+	return out
+}
+
+// mutateCountMismatch flips the two bytes immediately following the
+// tag. For the "rstat" and "rwalk" targets in fuzzTargets that is
+// exactly the nstat/nwqid count field, so the corrupted value
+// disagrees with the trailing payload; for "rread" and "rwrite" the
+// same two bytes are the low half of the four-byte count field, and
+// for "rversion", "rattach", "ropen" and "rcreate" they fall inside
+// msize or the leading QID instead of any count. In every case the
+// mutation still corrupts a field the client must validate, even
+// where it is not literally an element count.
+func mutateCountMismatch(frame []byte, rng *rand.Rand) []byte {
+	out := append([]byte(nil), frame...)
+	if len(out) >= 9 {
+		out[7] ^= 0xff
+		out[8] ^= 0xff
+	}
+	return out
+}
+
+// mutateFlipTypeByte sets the message type byte to current^1, turning
+// e.g. an odd R-message into the preceding even T-message type.
+func mutateFlipTypeByte(frame []byte, rng *rand.Rand) []byte {
+	out := append([]byte(nil), frame...)
+	if len(out) >= 5 {
+		out[4] ^= 1
+	}
+	return out
+}
+
+// fuzzTarget builds a well-formed R-message frame for the T-message in
+// b by delegating to the matching *Success handler and capturing its
+// output, rather than duplicating the marshalling logic.
+type fuzzTarget func(b *bytes.Buffer) ([]byte, error)
+
+// buildFrame runs reply against a copy of the incoming T-message and
+// returns the resulting well-formed frame.
+func buildFrame(reply func(*bytes.Buffer) error, b *bytes.Buffer) ([]byte, error) {
+	tmp := bytes.NewBuffer(append([]byte(nil), b.Bytes()...))
+	if err := reply(tmp); err != nil {
+		return nil, err
+	}
+
+	return tmp.Bytes(), nil
+}
+
+// fuzzTargets maps the name written after "fuzz" on the control
+// socket to the handler that produces the well-formed frame to mutate.
+var fuzzTargets = map[string]fuzzTarget{
+	"rversion": func(b *bytes.Buffer) ([]byte, error) { return buildFrame(RversionSuccess, b) },
+	"rattach":  func(b *bytes.Buffer) ([]byte, error) { return buildFrame(RattachSuccess, b) },
+	"rstat":    func(b *bytes.Buffer) ([]byte, error) { return buildFrame(RstatSuccess, b) },
+	"rwalk":    func(b *bytes.Buffer) ([]byte, error) { return buildFrame(RwalkSuccess, b) },
+	"ropen":    func(b *bytes.Buffer) ([]byte, error) { return buildFrame(RopenSuccess, b) },
+	"rread":    func(b *bytes.Buffer) ([]byte, error) { return buildFrame(RreadSuccess, b) },
+	"rwrite":   func(b *bytes.Buffer) ([]byte, error) { return buildFrame(RwriteSuccess, b) },
+	"rcreate":  func(b *bytes.Buffer) ([]byte, error) { return buildFrame(RcreateSuccess, b) },
+}
+
+// Fuzz parses the T-message in b, builds a well-formed R-message of
+// the requested kind, and applies mutators[idx%len(mutators)] seeded
+// with seed so a failing case can be replayed deterministically by
+// repeating the same target, idx and seed.
+func Fuzz(target string, idx int, seed int64, b *bytes.Buffer) error {
+	build, ok := fuzzTargets[target]
+	if !ok {
+		return fmt.Errorf("fuzz: unknown target %q", target)
+	}
+
+	frame, err := build(b)
+	if err != nil {
+		return err
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+
+	// idx wraps around the fixed menu regardless of sign, so any int
+	// (including the negative values go test -fuzz will eventually
+	// try) selects a valid mutator instead of panicking.
+	mutator := ((idx % len(mutators)) + len(mutators)) % len(mutators)
+	frame = mutators[mutator](frame, rng)
+
+	b.Reset()
+	b.Write(frame)
+	return nil
+}
+
+// ParseFuzzCommand parses a control-socket line of the form
+// "fuzz <target> <idx> <seed>", e.g. "fuzz rread 42 7", as written by
+// the control-socket dispatcher before calling Fuzz.
+func ParseFuzzCommand(line string) (target string, idx int, seed int64, err error) {
+	fields := strings.Fields(line)
+	if len(fields) != 4 || fields[0] != "fuzz" {
+		return "", 0, 0, fmt.Errorf("fuzz: malformed command %q", line)
+	}
+
+	idx64, err := strconv.ParseInt(fields[2], 10, 0)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("fuzz: invalid mutator index: %w", err)
+	}
+
+	seed, err = strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return "", 0, 0, fmt.Errorf("fuzz: invalid seed: %w", err)
+	}
+
+	return fields[1], int(idx64), seed, nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Harvey-OS/ninep/protocol"
+)
+
+// putString appends s to b as a standard 9P string: a two-byte
+// little-endian length followed by the raw bytes.
+func putString(b *bytes.Buffer, s string) {
+	putUint16LE(b, uint16(len(s)))
+	b.Write([]byte(s))
+}
+
+// seedTMessage builds a well-formed T-message for target, matching
+// the layout the corresponding protocol.UnmarshalT*Pkt call inside
+// fuzzTargets expects. It returns nil for an unknown target.
+func seedTMessage(target string) []byte {
+	var body bytes.Buffer
+	var mtype uint8
+	const tag uint16 = 1
+
+	switch target {
+	case "rversion":
+		mtype = uint8(protocol.Tversion)
+		putUint32LE(&body, 8192)
+		putString(&body, "9P2000")
+	case "rattach":
+		mtype = uint8(protocol.Tattach)
+		putUint32LE(&body, 1)          // fid
+		putUint32LE(&body, 0xffffffff) // afid, NOFID
+		putString(&body, "glenda")
+		putString(&body, "")
+	case "rstat":
+		mtype = uint8(protocol.Tstat)
+		putUint32LE(&body, 1) // fid
+	case "rwalk":
+		mtype = uint8(protocol.Twalk)
+		putUint32LE(&body, 1) // fid
+		putUint32LE(&body, 2) // newfid
+		putUint16LE(&body, 1) // nwname
+		putString(&body, "sub")
+	case "ropen":
+		mtype = uint8(protocol.Topen)
+		putUint32LE(&body, 1) // fid
+		body.WriteByte(0)     // mode
+	case "rread":
+		mtype = uint8(protocol.Tread)
+		putUint32LE(&body, 1)  // fid
+		putUint64LE(&body, 0)  // offset
+		putUint32LE(&body, 64) // count
+	case "rwrite":
+		mtype = uint8(protocol.Twrite)
+		putUint32LE(&body, 1) // fid
+		putUint64LE(&body, 0) // offset
+		data := []byte("payload")
+		putUint32LE(&body, uint32(len(data)))
+		body.Write(data)
+	case "rcreate":
+		mtype = uint8(protocol.Tcreate)
+		putUint32LE(&body, 1) // fid
+		putString(&body, "newfile")
+		putUint32LE(&body, 0644) // perm
+		body.WriteByte(0)        // mode
+	default:
+		return nil
+	}
+
+	msg := []byte{0, 0, 0, 0, mtype, byte(tag), byte(tag >> 8)}
+	msg = append(msg, body.Bytes()...)
+	fixupFrameSize(msg)
+	return msg
+}
+
+// FuzzMutate feeds Fuzz a corpus of (target, mutator index, seed)
+// triples seeded from every entry in fuzzTargets, so `go test -fuzz`
+// can grow the corpus and surface crashing mutator/parser
+// combinations on its own.
+func FuzzMutate(f *testing.F) {
+	for target := range fuzzTargets {
+		f.Add(target, 0, int64(1))
+		f.Add(target, len(mutators)-1, int64(42))
+	}
+
+	f.Fuzz(func(t *testing.T, target string, idx int, seed int64) {
+		msg := seedTMessage(target)
+		if msg == nil {
+			t.Skip("unknown fuzz target")
+		}
+
+		// Errors are an expected outcome of mutating a well-formed
+		// frame or picking an out-of-range idx; FuzzMutate is only
+		// looking for panics and hangs, not for Fuzz to succeed.
+		_ = Fuzz(target, idx, seed, bytes.NewBuffer(msg))
+	})
+}
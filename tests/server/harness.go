@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/Harvey-OS/ninep/protocol"
+)
+
+// Harness serves ctlcmds entries and scenarios over a Channel, which
+// is what actually puts the Channel/Codec abstraction from channel.go
+// to use: the same ServeCommand logic below runs unmodified whether
+// ch was built by NewTCPChannel, NewUnixChannel or NewTLSChannel.
+type Harness struct {
+	ch    Channel
+	codec Codec
+}
+
+// NewHarness returns a Harness that serves ctlcmds/scenarios over ch,
+// using RawCodec to hand the *bytes.Buffer every ServerReply already
+// expects.
+func NewHarness(ch Channel) *Harness {
+	return &Harness{ch: ch, codec: RawCodec{}}
+}
+
+// NewTCPHarness dials out the Channel/Codec plumbing for conn in one
+// step.
+func NewTCPHarness(conn *net.TCPConn) *Harness {
+	return NewHarness(NewTCPChannel(conn))
+}
+
+// NewUnixHarness dials out the Channel/Codec plumbing for conn in one
+// step.
+func NewUnixHarness(conn *net.UnixConn) *Harness {
+	return NewHarness(NewUnixChannel(conn))
+}
+
+// NewTLSHarness dials out the Channel/Codec plumbing for conn in one
+// step.
+func NewTLSHarness(conn *tls.Conn) *Harness {
+	return NewHarness(NewTLSChannel(conn))
+}
+
+// ServeCommand runs the scenario, ctlcmds entry or fuzz command named
+// by cmd against h's Channel until it is exhausted, the client deviates
+// from what a scenario expects, or the Channel returns an error. A
+// "fuzz ..." line is handled directly instead of being a ctlcmds entry
+// since it carries its own arguments (target, mutator index, seed)
+// rather than naming a fixed reply.
+func (h *Harness) ServeCommand(cmd string) error {
+	if strings.HasPrefix(cmd, "fuzz ") {
+		return h.serveFuzz(cmd)
+	}
+	if s, ok := scenarios[cmd]; ok {
+		return h.serveScenario(s)
+	}
+	if reply, ok := ctlcmds[cmd]; ok {
+		return h.serveOnce(reply)
+	}
+
+	return fmt.Errorf("harness: unknown command %q", cmd)
+}
+
+// serveFuzz parses cmd as a "fuzz <target> <idx> <seed>" line, reads a
+// single T-message and answers it with the mutated frame Fuzz builds.
+func (h *Harness) serveFuzz(cmd string) error {
+	target, idx, seed, err := ParseFuzzCommand(cmd)
+	if err != nil {
+		return err
+	}
+
+	buf, err := h.readBuffer()
+	if err != nil {
+		return err
+	}
+
+	if err := Fuzz(target, idx, seed, buf); err != nil {
+		return err
+	}
+
+	return h.writeBuffer(buf)
+}
+
+// serveOnce reads a single T-message and answers it with reply.
+func (h *Harness) serveOnce(reply ServerReply) error {
+	buf, err := h.readBuffer()
+	if err != nil {
+		return err
+	}
+
+	if err := reply.Func(buf); err != nil {
+		return err
+	}
+
+	return h.writeBuffer(buf)
+}
+
+// serveScenario drives s to completion, reading one T-message per
+// step and feeding ScenarioRunner.Next the header fields it needs to
+// enforce each step's ExpectFid/ExpectTag constraints.
+func (h *Harness) serveScenario(s Scenario) error {
+	r := NewScenarioRunner(s)
+
+	for !r.Done() {
+		buf, err := h.readBuffer()
+		if err != nil {
+			return err
+		}
+
+		gotType, gotFid, gotTag, err := peekHeader(buf)
+		if err != nil {
+			return err
+		}
+
+		if err := r.Next(buf, gotType, gotFid, gotTag); err != nil {
+			return err
+		}
+
+		if err := h.writeBuffer(buf); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readBuffer reads one framed message off h.ch and decodes it through
+// h.codec.
+func (h *Harness) readBuffer() (*bytes.Buffer, error) {
+	msg, err := h.ch.ReadFcall()
+	if err != nil {
+		return nil, err
+	}
+
+	decoded, err := h.codec.Decode(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	buf, ok := decoded.(*bytes.Buffer)
+	if !ok {
+		return nil, fmt.Errorf("harness: codec decoded %T, want *bytes.Buffer", decoded)
+	}
+
+	return buf, nil
+}
+
+// writeBuffer encodes buf through h.codec and writes the result as a
+// single framed message on h.ch.
+func (h *Harness) writeBuffer(buf *bytes.Buffer) error {
+	out, err := h.codec.Encode(buf)
+	if err != nil {
+		return err
+	}
+
+	return h.ch.WriteFcall(out)
+}
+
+// peekHeader reads the message type, tag and (when present) leading
+// fid out of buf without consuming it, so the ServerReply for the
+// current step can still unmarshal the full message afterwards.
+func peekHeader(buf *bytes.Buffer) (mtype protocol.MType, fid uint32, tag uint16, err error) {
+	raw := buf.Bytes()
+	if len(raw) < 7 {
+		return 0, 0, 0, fmt.Errorf("harness: message too short to contain a 9P header")
+	}
+
+	mtype = protocol.MType(raw[4])
+	tag = uint16(raw[5]) | uint16(raw[6])<<8
+	if len(raw) >= 11 {
+		fid = uint32(raw[7]) | uint32(raw[8])<<8 | uint32(raw[9])<<16 | uint32(raw[10])<<24
+	}
+
+	return mtype, fid, tag, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"log"
+	"net"
+)
+
+// main runs the control-socket server described throughout this
+// package: each accepted connection reads one command line, naming a
+// ctlcmds entry, a scenario or a "fuzz ..." command, and is served by
+// a Harness until the client disconnects or a step fails.
+func main() {
+	addr := flag.String("addr", "", "serve over TCP on this address instead of a Unix socket")
+	socket := flag.String("socket", "/tmp/9riot.sock", "Unix socket path to serve on when -addr is unset")
+	flag.Parse()
+
+	network, laddr := "unix", *socket
+	if *addr != "" {
+		network, laddr = "tcp", *addr
+	}
+
+	l, err := net.Listen(network, laddr)
+	if err != nil {
+		log.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			log.Printf("accept: %v", err)
+			continue
+		}
+
+		go serveConn(conn)
+	}
+}
+
+// serveConn reads newline-terminated commands off conn and dispatches
+// each to a fresh Harness until the client disconnects.
+func serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	h, err := newConnHarness(conn)
+	if err != nil {
+		log.Printf("harness: %v", err)
+		return
+	}
+
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		if err := h.ServeCommand(scanner.Text()); err != nil {
+			log.Printf("serve: %v", err)
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Printf("scan: %v", err)
+	}
+}
+
+// newConnHarness builds the Harness matching conn's concrete type, so
+// serveConn works the same way whether the listener above is a TCP or
+// Unix listener.
+func newConnHarness(conn net.Conn) (*Harness, error) {
+	switch c := conn.(type) {
+	case *net.TCPConn:
+		return NewTCPHarness(c), nil
+	case *net.UnixConn:
+		return NewUnixHarness(c), nil
+	default:
+		return NewHarness(&streamChannel{rw: conn}), nil
+	}
+}
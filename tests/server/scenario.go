@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/Harvey-OS/ninep/protocol"
+)
+
+// A Step describes one exchange within a Scenario: the ServerReply to
+// send back to the client and, optionally, constraints the incoming
+// T-message must satisfy before the reply is sent. A nil pointer means
+// the corresponding field is not checked.
+type Step struct {
+	Reply ServerReply
+
+	ExpectFid *uint32
+	ExpectTag *uint16
+}
+
+// A Scenario drives the client through several request/reply steps in
+// sequence, e.g. Tversion -> Tattach -> Twalk -> Topen -> Tread where
+// only the Tread step replies with a malformed Rread. Single-shot
+// entries from ctlcmds are expressible as a one-step Scenario.
+type Scenario []Step
+
+// Maps strings written by the control socket to multi-step scenarios.
+// Unlike ctlcmds, a scenario name stays bound to the connection across
+// several T-messages until the scenario is exhausted or a step fails.
+var scenarios = map[string]Scenario{}
+
+func init() {
+	// Every existing ctlcmds entry is also reachable as a one-step
+	// scenario under the same name, so callers driving scenarios
+	// exclusively do not lose access to the single-shot tests.
+	for name, reply := range ctlcmds {
+		scenarios[name] = Scenario{{Reply: reply}}
+	}
+
+	// A realistic session where only the final Tread reply is
+	// malformed; everything up to that point must succeed.
+	scenarios["walk_open_read_bad_read"] = Scenario{
+		{Reply: ctlcmds["rversion_success"]},
+		{Reply: ctlcmds["rattach_success"]},
+		{Reply: ctlcmds["rwalk_success"]},
+		{Reply: ctlcmds["ropen_success"]},
+		{Reply: ctlcmds["rread_count_invalid"]},
+	}
+
+	// Exercises ExpectFid and ExpectTag: the client must keep reusing
+	// fid 1, the one it attached, across Twalk and Topen, and must
+	// advance its tag by one on every step. A client that attaches
+	// with one fid but walks or opens with another, or that reuses a
+	// tag still outstanding, fails this scenario immediately instead
+	// of silently getting away with it.
+	scenarios["attach_fid_reuse"] = Scenario{
+		{Reply: ctlcmds["rversion_success"], ExpectTag: uint16ptr(0xffff)}, // NOTAG
+		{Reply: ctlcmds["rattach_success"], ExpectFid: uint32ptr(1), ExpectTag: uint16ptr(1)},
+		{Reply: ctlcmds["rwalk_success"], ExpectFid: uint32ptr(1), ExpectTag: uint16ptr(2)},
+		{Reply: ctlcmds["ropen_success"], ExpectFid: uint32ptr(1), ExpectTag: uint16ptr(3)},
+	}
+}
+
+// uint32ptr and uint16ptr let Step literals take the address of a
+// constant without an intermediate variable at each call site.
+func uint32ptr(v uint32) *uint32 { return &v }
+func uint16ptr(v uint16) *uint16 { return &v }
+
+// A ScenarioRunner drives a single client connection through a
+// Scenario, tracking which step is next and failing loudly as soon as
+// the client deviates from the expected sequence.
+type ScenarioRunner struct {
+	scenario Scenario
+	step     int
+}
+
+// NewScenarioRunner returns a runner positioned at the first step of s.
+func NewScenarioRunner(s Scenario) *ScenarioRunner {
+	return &ScenarioRunner{scenario: s}
+}
+
+// Done reports whether every step of the scenario has been consumed.
+func (r *ScenarioRunner) Done() bool {
+	return r.step >= len(r.scenario)
+}
+
+// Next consumes the T-message in b against the current step: it checks
+// the expected type (carried by the step's ServerReply), fid and tag if
+// constrained, invokes the step's reply function to produce the
+// response in b, and advances to the next step. It returns an error
+// describing the mismatch if the client skipped a step, sent an
+// unexpected message type, or reused a fid/tag it should not have.
+func (r *ScenarioRunner) Next(b *bytes.Buffer, gotType protocol.MType, gotFid uint32, gotTag uint16) error {
+	if r.Done() {
+		return fmt.Errorf("scenario: client sent a message after the scenario was exhausted")
+	}
+
+	step := r.scenario[r.step]
+	if gotType != step.Reply.Type {
+		return fmt.Errorf("scenario: step %d expected message type %d, got %d", r.step, step.Reply.Type, gotType)
+	}
+	if step.ExpectFid != nil && *step.ExpectFid != gotFid {
+		return fmt.Errorf("scenario: step %d expected fid %d, got %d", r.step, *step.ExpectFid, gotFid)
+	}
+	if step.ExpectTag != nil && *step.ExpectTag != gotTag {
+		return fmt.Errorf("scenario: step %d expected tag %d, got %d", r.step, *step.ExpectTag, gotTag)
+	}
+
+	if err := step.Reply.Func(b); err != nil {
+		return err
+	}
+
+	r.step++
+	return nil
+}
@@ -5,6 +5,14 @@ import (
 	"github.com/Harvey-OS/ninep/protocol"
 )
 
+// A ServerReply pairs the handler that produces a test's R-message with
+// the T-message type it expects to be driven by, so callers such as
+// ScenarioRunner can validate the incoming message before invoking Func.
+type ServerReply struct {
+	Func func(*bytes.Buffer) error
+	Type protocol.MType
+}
+
 // Maps strings written by the client to the control socket to
 // server replies. Every test function needs an entry in this table.
 var ctlcmds = map[string]ServerReply{
@@ -28,13 +36,52 @@ var ctlcmds = map[string]ServerReply{
 
 	"rstat_success":       {RstatSuccess, protocol.Tstat},
 	"rstat_nstat_invalid": {RstatNstatInvalid, protocol.Tstat},
+
+	"rwalk_success":        {RwalkSuccess, protocol.Twalk},
+	"rwalk_nwqid_mismatch": {RwalkNwqidMismatch, protocol.Twalk},
+
+	"ropen_success":        {RopenSuccess, protocol.Topen},
+	"ropen_wrong_qid_type": {RopenWrongQidType, protocol.Topen},
+
+	"rread_success":       {RreadSuccess, protocol.Tread},
+	"rread_count_invalid": {RreadCountInvalid, protocol.Tread},
+
+	"rwrite_success": {RwriteSuccess, protocol.Twrite},
+
+	"rcreate_success":        {RcreateSuccess, protocol.Tcreate},
+	"rcreate_wrong_qid_type": {RcreateWrongQidType, protocol.Tcreate},
+
+	"rclunk_success": {RclunkSuccess, protocol.Tclunk},
+
+	"rremove_success": {RremoveSuccess, protocol.Tremove},
+
+	"rwstat_success": {RwstatSuccess, protocol.Twstat},
+
+	"rauth_success":    {RauthSuccess, protocol.Tauth},
+	"rauth_unexpected": {RauthUnexpected, protocol.Tversion},
+
+	"rerror_success":        {RerrorSuccess, protocol.Tattach},
+	"rerror_length_invalid": {RerrorLengthInvalid, protocol.Tattach},
+
+	"rversion_downgraded":           {RversionDowngraded, protocol.Tversion},
+	"rversion_unadvertised_dialect": {RversionUnadvertisedDialect, protocol.Tversion},
+	"rstat_dotu_missing_extension":  {RstatDotuMissingExtension, protocol.Tstat},
+
+	"rlopen_success":   {RlopenSuccess, Tlopen},
+	"rreaddir_success": {RreaddirSuccess, Treaddir},
+	"rgetattr_success": {RgetattrSuccess, Tgetattr},
+	"rlerror_success":  {RlerrorSuccess, Tlopen},
 }
 
 // Replies with a single byte. This is thus even shorter than the four-byte
 // length field and should not be parsed by the client succesfully.
+//
+// This is now a tiny emitter on top of the headerTooShort1Frame built
+// for the Channel abstraction in channel.go; the *bytes.Buffer based
+// ServerReply table still drives it directly.
 func HeaderTooShort1(b *bytes.Buffer) error {
 	b.Reset()
-	b.Write([]byte{0})
+	b.Write(headerTooShort1Frame())
 	return nil
 }
 
@@ -42,8 +89,7 @@ func HeaderTooShort1(b *bytes.Buffer) error {
 // that is too small to make the message a valid 9p message.
 func HeaderTooShort2(b *bytes.Buffer) error {
 	b.Reset()
-	l := uint64(6)
-	b.Write([]byte{uint8(l), uint8(l >> 8), uint8(l >> 16), uint8(l >> 24)})
+	b.Write(headerTooShort2Frame())
 	return nil
 }
 
@@ -51,9 +97,7 @@ func HeaderTooShort2(b *bytes.Buffer) error {
 // send to the client.
 func HeaderTooLarge(b *bytes.Buffer) error {
 	b.Reset()
-
-	l := uint64(42)
-	b.Write([]byte{uint8(l), uint8(l >> 8), uint8(l >> 16), uint8(l >> 24)})
+	b.Write(headerTooLargeFrame())
 	return nil
 }
 
@@ -65,16 +109,7 @@ func HeaderWrongType(b *bytes.Buffer) error {
 	}
 
 	b.Reset()
-	b.Write([]byte{0, 0, 0, 0,
-		uint8(protocol.Tversion),
-		byte(t), byte(t >> 8),
-		byte(0), byte(0), byte(0), byte(0)})
-
-	{
-		l := uint64(b.Len())
-		copy(b.Bytes(), []byte{uint8(l), uint8(l >> 8), uint8(l >> 16), uint8(l >> 24)})
-	}
-
+	b.Write(headerWrongTypeFrame(t))
 	return nil
 }
 
@@ -87,11 +122,7 @@ func HeaderInvalidType(b *bytes.Buffer) error {
 	}
 
 	b.Reset()
-	b.Write([]byte{0, 0, 0, 0,
-		uint8(protocol.Tlast),
-		byte(t), byte(t >> 8),
-		byte(0), byte(0), byte(0), byte(0)})
-
+	b.Write(headerInvalidTypeFrame(t))
 	return nil
 }
 
@@ -103,14 +134,8 @@ func HeaderTagMismatch(b *bytes.Buffer) error {
 		return err
 	}
 
-	t += 1
-
 	b.Reset()
-	b.Write([]byte{0, 0, 0, 0,
-		uint8(protocol.Rversion),
-		byte(t), byte(t >> 8),
-		byte(0), byte(0), byte(0), byte(0)})
-
+	b.Write(headerTagMismatchFrame(t))
 	return nil
 }
 
@@ -124,11 +149,7 @@ func HeaderTypeMismatch(b *bytes.Buffer) error {
 	}
 
 	b.Reset()
-	b.Write([]byte{0, 0, 0, 0,
-		uint8(protocol.Rversion),
-		byte(t), byte(t >> 8),
-		byte(0), byte(0), byte(0), byte(0)})
-
+	b.Write(headerTypeMismatchFrame(t))
 	return nil
 }
 
@@ -216,13 +237,8 @@ func RversionInvalidLength(b *bytes.Buffer) error {
 		return err
 	}
 
-	protocol.MarshalRversionPkt(b, t, TMsize, TVersion)
-
-	{
-		var l uint64 = uint64(b.Len() - 1)
-		copy(b.Bytes(), []byte{uint8(l), uint8(l >> 8), uint8(l >> 16), uint8(l >> 24)})
-	}
-
+	b.Reset()
+	b.Write(rversionInvalidLengthFrame(t, TMsize, TVersion))
 	return nil
 }
 
@@ -262,13 +278,8 @@ func RattachInvalidLength(b *bytes.Buffer) error {
 		return err
 	}
 
-	protocol.MarshalRattachPkt(b, t, protocol.QID{})
-
-	{
-		var l uint64 = uint64(b.Len() - 1)
-		copy(b.Bytes(), []byte{uint8(l), uint8(l >> 8), uint8(l >> 16), uint8(l >> 24)})
-	}
-
+	b.Reset()
+	b.Write(rattachInvalidLengthFrame(t))
 	return nil
 }
 
@@ -341,3 +352,251 @@ func RstatNstatInvalid(b *bytes.Buffer) error {
 
 	return nil
 }
+
+// Replies with one QID per wname component send by the client. The
+// client must be able to parse this successfully.
+func RwalkSuccess(b *bytes.Buffer) error {
+	_, _, wname, t, err := protocol.UnmarshalTwalkPkt(b)
+	if err != nil {
+		return err
+	}
+
+	wqid := make([]protocol.QID, len(wname))
+	for i := range wqid {
+		wqid[i] = protocol.QID{Type: protocol.QTDIR, Path: uint64(i)}
+	}
+
+	protocol.MarshalRwalkPkt(b, t, wqid)
+	return nil
+}
+
+// Replies with fewer QIDs than wname components were send by the
+// client. The client should not accept this as a valid walk reply.
+func RwalkNwqidMismatch(b *bytes.Buffer) error {
+	_, _, wname, t, err := protocol.UnmarshalTwalkPkt(b)
+	if err != nil {
+		return err
+	}
+
+	var wqid []protocol.QID
+	if len(wname) > 0 {
+		wqid = []protocol.QID{{Type: protocol.QTDIR}}
+	}
+
+	protocol.MarshalRwalkPkt(b, t, wqid)
+	return nil
+}
+
+// Replies with a QID for a plain file. The client must be able to
+// parse this successfully.
+func RopenSuccess(b *bytes.Buffer) error {
+	_, _, t, err := protocol.UnmarshalTopenPkt(b)
+	if err != nil {
+		return err
+	}
+
+	protocol.MarshalRopenPkt(b, t, protocol.QID{}, 0)
+	return nil
+}
+
+// Replies with the QTDIR bit set on the returned QID even though the
+// fid was opened for I/O, not for directory reads. The client should
+// reject this as inconsistent.
+func RopenWrongQidType(b *bytes.Buffer) error {
+	_, _, t, err := protocol.UnmarshalTopenPkt(b)
+	if err != nil {
+		return err
+	}
+
+	protocol.MarshalRopenPkt(b, t, protocol.QID{Type: protocol.QTDIR}, 0)
+	return nil
+}
+
+// Replies with as many bytes of data as the client requested. The
+// client must be able to parse this successfully.
+func RreadSuccess(b *bytes.Buffer) error {
+	_, _, count, t, err := protocol.UnmarshalTreadPkt(b)
+	if err != nil {
+		return err
+	}
+
+	data := make([]byte, count)
+	protocol.MarshalRreadPkt(b, t, data)
+	return nil
+}
+
+// Replies with a count field that claims more data is present than was
+// actually written to the packet. The client should not be able to
+// parse this successfully.
+func RreadCountInvalid(b *bytes.Buffer) error {
+	_, _, count, t, err := protocol.UnmarshalTreadPkt(b)
+	if err != nil {
+		return err
+	}
+
+	n := count + 1
+
+	b.Reset()
+	b.Write([]byte{0, 0, 0, 0,
+		uint8(protocol.Rread),
+		byte(t), byte(t >> 8),
+		uint8(n), uint8(n >> 8), uint8(n >> 16), uint8(n >> 24),
+	})
+
+	{
+		l := uint64(b.Len())
+		copy(b.Bytes(), []byte{uint8(l), uint8(l >> 8), uint8(l >> 16), uint8(l >> 24)})
+	}
+
+	return nil
+}
+
+// Replies with the number of bytes the client asked to have written.
+// The client must be able to parse this successfully.
+func RwriteSuccess(b *bytes.Buffer) error {
+	_, _, data, t, err := protocol.UnmarshalTwritePkt(b)
+	if err != nil {
+		return err
+	}
+
+	protocol.MarshalRwritePkt(b, t, protocol.Count(len(data)))
+	return nil
+}
+
+// Replies with a QID for a freshly created plain file. The client must
+// be able to parse this successfully.
+func RcreateSuccess(b *bytes.Buffer) error {
+	_, _, _, _, t, err := protocol.UnmarshalTcreatePkt(b)
+	if err != nil {
+		return err
+	}
+
+	protocol.MarshalRcreatePkt(b, t, protocol.QID{}, 0)
+	return nil
+}
+
+// Replies with the QTDIR bit set even though the client did not
+// request DMDIR permissions. The client should reject this as
+// inconsistent.
+func RcreateWrongQidType(b *bytes.Buffer) error {
+	_, _, _, _, t, err := protocol.UnmarshalTcreatePkt(b)
+	if err != nil {
+		return err
+	}
+
+	protocol.MarshalRcreatePkt(b, t, protocol.QID{Type: protocol.QTDIR}, 0)
+	return nil
+}
+
+// Replies that the clunk succeeded. The client must be able to parse
+// this successfully.
+func RclunkSuccess(b *bytes.Buffer) error {
+	_, t, err := protocol.UnmarshalTclunkPkt(b)
+	if err != nil {
+		return err
+	}
+
+	protocol.MarshalRclunkPkt(b, t)
+	return nil
+}
+
+// Replies that the remove succeeded. The client must be able to parse
+// this successfully.
+func RremoveSuccess(b *bytes.Buffer) error {
+	_, t, err := protocol.UnmarshalTremovePkt(b)
+	if err != nil {
+		return err
+	}
+
+	protocol.MarshalRremovePkt(b, t)
+	return nil
+}
+
+// Replies that the wstat succeeded. The client must be able to parse
+// this successfully.
+func RwstatSuccess(b *bytes.Buffer) error {
+	_, _, t, err := protocol.UnmarshalTwstatPkt(b)
+	if err != nil {
+		return err
+	}
+
+	protocol.MarshalRwstatPkt(b, t)
+	return nil
+}
+
+// marshalRauth writes a hand-rolled Rauth message carrying aqid for tag
+// t. The vendored protocol package has no Tauth/Rauth marshal pair at
+// all, not even an unsupported-dialect stand-in, so this is assembled
+// the same way the 9P2000.L replies in dialect.go build messages the
+// library doesn't know about.
+func marshalRauth(b *bytes.Buffer, t uint16, aqid protocol.QID) {
+	b.Reset()
+	b.Write([]byte{0, 0, 0, 0, uint8(protocol.Rauth), byte(t), byte(t >> 8)})
+	putQID(b, aqid)
+	fixupSize(b)
+}
+
+// Replies with a valid auth QID. The client must be able to parse this
+// successfully.
+func RauthSuccess(b *bytes.Buffer) error {
+	t, err := unmarshalLHeader(b)
+	if err != nil {
+		return err
+	}
+
+	marshalRauth(b, t, protocol.QID{Type: protocol.QTAUTH})
+	return nil
+}
+
+// Replies with an Rauth message even though the client never sent a
+// Tauth request. The client should reject this unsolicited reply.
+func RauthUnexpected(b *bytes.Buffer) error {
+	_, _, t, err := protocol.UnmarshalTversionPkt(b)
+	if err != nil {
+		return err
+	}
+
+	marshalRauth(b, uint16(t), protocol.QID{Type: protocol.QTAUTH})
+	return nil
+}
+
+// Replies with an Rerror message carrying a generic error string. The
+// client must be able to parse this successfully and surface the
+// error to the caller.
+func RerrorSuccess(b *bytes.Buffer) error {
+	_, _, _, _, t, err := protocol.UnmarshalTattachPkt(b)
+	if err != nil {
+		return err
+	}
+
+	protocol.MarshalRerrorPkt(b, t, "permission denied")
+	return nil
+}
+
+// Replies with an Rerror message whose ename length field claims the
+// string is longer than the bytes actually present in the packet. The
+// client should not be able to parse this successfully.
+func RerrorLengthInvalid(b *bytes.Buffer) error {
+	_, _, _, _, t, err := protocol.UnmarshalTattachPkt(b)
+	if err != nil {
+		return err
+	}
+
+	ename := "short"
+	var n uint16 = uint16(len(ename) + 42)
+
+	b.Reset()
+	b.Write([]byte{0, 0, 0, 0,
+		uint8(protocol.Rerror),
+		byte(t), byte(t >> 8),
+		uint8(n), uint8(n >> 8),
+	})
+	b.Write([]byte(ename))
+
+	{
+		l := uint64(b.Len())
+		copy(b.Bytes(), []byte{uint8(l), uint8(l >> 8), uint8(l >> 16), uint8(l >> 24)})
+	}
+
+	return nil
+}